@@ -0,0 +1,355 @@
+// Go CGO cross compiler
+// Copyright (c) 2014 Péter Szilágyi. All rights reserved.
+//
+// Released under the MIT license.
+
+// Package archive packages cross compiled binaries into per-platform release
+// archives, writes a combined checksum manifest, and optionally GPG-signs and
+// uploads the results. It replaces the ad-hoc shell scripts xgo users tend to
+// bolt onto their release pipelines.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Options configures the packaging step run after a cross compilation.
+type Options struct {
+	Type   string // Archive format to produce: "zip" or "tar.gz"
+	Dest   string // Folder holding the built binaries, and where archives are written
+	Prefix string // Output naming prefix (same prefix the build used)
+	Signer string // Env var holding an ASCII-armored GPG private key (empty = don't sign)
+	Upload string // Base URL to PUT archives and the sums file to (empty = don't upload)
+}
+
+// sumFile is the name of the combined checksum manifest.
+const sumFile = "SHA256SUMS"
+
+// Package builds one archive per requested target out of the binaries already
+// produced by compile, writes a SHA256SUMS manifest next to them, and
+// optionally signs and uploads the results.
+func Package(ctx context.Context, opts Options, targets []string) error {
+	if opts.Type == "" {
+		return nil
+	}
+	ext, err := extensionFor(opts.Type)
+	if err != nil {
+		return err
+	}
+	sums := make(map[string]string)
+
+	for _, target := range targets {
+		goos, goarch, err := splitTarget(target)
+		if err != nil {
+			return err
+		}
+		if strings.ContainsAny(goos+goarch, "*?[") {
+			fmt.Printf("Target %s is a wildcard, skipping archive (pass concrete os/arch pairs to -targets to archive).\n", target)
+			continue
+		}
+		binaries, err := matchBinaries(opts.Dest, opts.Prefix, goos, goarch)
+		if err != nil {
+			return err
+		}
+		if len(binaries) == 0 {
+			fmt.Printf("No binaries found for %s/%s, skipping archive.\n", goos, goarch)
+			continue
+		}
+		name := fmt.Sprintf("%s_%s_%s.%s", opts.Prefix, goos, goarch, ext)
+		path := filepath.Join(opts.Dest, name)
+
+		if err := writeArchive(opts.Type, path, binaries); err != nil {
+			return err
+		}
+		sum, err := sha256sum(path)
+		if err != nil {
+			return err
+		}
+		sums[name] = sum
+	}
+	sumsPath := filepath.Join(opts.Dest, sumFile)
+	if err := writeSums(sumsPath, sums); err != nil {
+		return err
+	}
+	archives := make([]string, 0, len(sums)+1)
+	for name := range sums {
+		archives = append(archives, filepath.Join(opts.Dest, name))
+	}
+	archives = append(archives, sumsPath)
+
+	if opts.Signer != "" {
+		key := os.Getenv(opts.Signer)
+		if key == "" {
+			return fmt.Errorf("signer env var %q is empty or unset", opts.Signer)
+		}
+		for _, path := range archives {
+			if err := sign(ctx, key, path); err != nil {
+				return fmt.Errorf("failed to sign %s: %v", path, err)
+			}
+			archives = append(archives, path+".asc")
+		}
+	}
+	if opts.Upload != "" {
+		for _, path := range archives {
+			if err := upload(ctx, opts.Upload, path); err != nil {
+				return fmt.Errorf("failed to upload %s: %v", path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// extensionFor maps an archive type to its file extension.
+func extensionFor(archiveType string) (string, error) {
+	switch archiveType {
+	case "zip":
+		return "zip", nil
+	case "tar.gz":
+		return "tar.gz", nil
+	default:
+		return "", fmt.Errorf("unsupported archive type %q, want zip or tar.gz", archiveType)
+	}
+}
+
+// splitTarget breaks a "os/arch" build target into its components.
+func splitTarget(target string) (goos string, goarch string, err error) {
+	parts := strings.Split(target, "/")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid target %q, want os/arch", target)
+	}
+	return parts[0], parts[1], nil
+}
+
+// matchBinaries finds the binaries compile produced for goos/goarch. A plain
+// "prefix-goos-goarch*" glob isn't enough: darwin and windows builds carry a
+// minimum-OS-version infix between the os and arch (e.g.
+// "prog-darwin-10.6-amd64", "prog-windows-4.0-amd64.exe"), and on linux a
+// goarch that's itself a prefix of a sibling arch (e.g. "arm" vs "arm64")
+// would otherwise over-match. So every candidate "prefix-goos-*" file is
+// matched by its actual trailing arch token instead of by glob alone.
+func matchBinaries(dest string, prefix string, goos string, goarch string) ([]string, error) {
+	candidates, err := filepath.Glob(filepath.Join(dest, fmt.Sprintf("%s-%s-*", prefix, goos)))
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, candidate := range candidates {
+		if binaryArch(filepath.Base(candidate)) == goarch {
+			matches = append(matches, candidate)
+		}
+	}
+	return matches, nil
+}
+
+// binaryArch extracts the GOARCH token a compile output name ends in, e.g.
+// "prog-darwin-10.6-amd64" -> "amd64", "prog-windows-4.0-386.exe" -> "386",
+// "prog-linux-arm-7" -> "arm" (ARM builds append the ARM version as a
+// trailing numeric token, which isn't itself part of the arch).
+func binaryArch(name string) string {
+	name = strings.TrimSuffix(name, ".exe")
+	parts := strings.Split(name, "-")
+	if len(parts) == 0 {
+		return ""
+	}
+	last := parts[len(parts)-1]
+	if len(parts) >= 2 && parts[len(parts)-2] == "arm" {
+		if _, err := strconv.Atoi(last); err == nil {
+			return "arm"
+		}
+	}
+	return last
+}
+
+// writeArchive packages the given files into a single zip or tar.gz archive.
+func writeArchive(archiveType string, path string, files []string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	switch archiveType {
+	case "zip":
+		return writeZip(out, files)
+	case "tar.gz":
+		return writeTarGz(out, files)
+	default:
+		return fmt.Errorf("unsupported archive type %q, want zip or tar.gz", archiveType)
+	}
+}
+
+func writeZip(out *os.File, files []string) error {
+	w := zip.NewWriter(out)
+	defer w.Close()
+
+	for _, file := range files {
+		if err := addToZip(w, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addToZip(w *zip.Writer, file string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.Base(file)
+	header.Method = zip.Deflate
+
+	entry, err := w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	_, err = io.Copy(entry, in)
+	return err
+}
+
+func writeTarGz(out *os.File, files []string) error {
+	gz := gzip.NewWriter(out)
+	defer gz.Close()
+
+	w := tar.NewWriter(gz)
+	defer w.Close()
+
+	for _, file := range files {
+		if err := addToTar(w, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addToTar(w *tar.Writer, file string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.Base(file)
+
+	if err := w.WriteHeader(header); err != nil {
+		return err
+	}
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	_, err = io.Copy(w, in)
+	return err
+}
+
+// sha256sum returns the lowercase hex SHA-256 digest of a file.
+func sha256sum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeSums writes a sha256sum(1)-compatible manifest, sorted by file name so
+// repeated runs produce a stable diff.
+func writeSums(path string, sums map[string]string) error {
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s  %s\n", sums[name], name)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// sign detached-signs a file with the given ASCII-armored private key,
+// writing the signature alongside it as "<path>.asc". It shells out to gpg,
+// the same pattern xgo already uses for docker, so no GPG library dependency
+// is needed.
+func sign(ctx context.Context, key string, path string) error {
+	home, err := os.MkdirTemp("", "xgo-gnupg")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(home)
+
+	env := append(os.Environ(), "GNUPGHOME="+home)
+
+	imp := exec.CommandContext(ctx, "gpg", "--batch", "--import")
+	imp.Env = env
+	imp.Stdin = strings.NewReader(key)
+	if out, err := imp.CombinedOutput(); err != nil {
+		return fmt.Errorf("gpg import failed: %v: %s", err, out)
+	}
+
+	out := exec.CommandContext(ctx, "gpg", "--batch", "--yes", "--detach-sign", "--armor", "-o", path+".asc", path)
+	out.Env = env
+	if combined, err := out.CombinedOutput(); err != nil {
+		return fmt.Errorf("gpg sign failed: %v: %s", err, combined)
+	}
+	return nil
+}
+
+// upload PUTs a single file to destBase/<basename>, as used by presigned S3
+// and GCS upload URLs.
+func upload(ctx context.Context, destBase string, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	url := strings.TrimSuffix(destBase, "/") + "/" + filepath.Base(path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, f)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("upload to %s returned status %s", url, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSplitTarget(t *testing.T) {
+	tests := []struct {
+		target  string
+		goos    string
+		goarch  string
+		wantErr bool
+	}{
+		{target: "linux/amd64", goos: "linux", goarch: "amd64"},
+		{target: "darwin/arm64", goos: "darwin", goarch: "arm64"},
+		{target: "*/*", goos: "*", goarch: "*"},
+		{target: "linux", wantErr: true},
+		{target: "linux/amd64/extra", wantErr: true},
+	}
+	for _, tt := range tests {
+		goos, goarch, err := splitTarget(tt.target)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("splitTarget(%q): expected an error, got none", tt.target)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("splitTarget(%q): unexpected error: %v", tt.target, err)
+			continue
+		}
+		if goos != tt.goos || goarch != tt.goarch {
+			t.Errorf("splitTarget(%q) = %q, %q, want %q, %q", tt.target, goos, goarch, tt.goos, tt.goarch)
+		}
+	}
+}
+
+func TestExtensionFor(t *testing.T) {
+	tests := []struct {
+		archiveType string
+		ext         string
+		wantErr     bool
+	}{
+		{archiveType: "zip", ext: "zip"},
+		{archiveType: "tar.gz", ext: "tar.gz"},
+		{archiveType: "rar", wantErr: true},
+	}
+	for _, tt := range tests {
+		ext, err := extensionFor(tt.archiveType)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("extensionFor(%q): expected an error, got none", tt.archiveType)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("extensionFor(%q): unexpected error: %v", tt.archiveType, err)
+			continue
+		}
+		if ext != tt.ext {
+			t.Errorf("extensionFor(%q) = %q, want %q", tt.archiveType, ext, tt.ext)
+		}
+	}
+}
+
+func TestWriteSums(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "SHA256SUMS")
+
+	sums := map[string]string{
+		"b.tar.gz": "bbbb",
+		"a.tar.gz": "aaaa",
+	}
+	if err := writeSums(path, sums); err != nil {
+		t.Fatalf("writeSums: %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	want := "aaaa  a.tar.gz\nbbbb  b.tar.gz\n"
+	if string(got) != want {
+		t.Errorf("writeSums wrote %q, want %q (names must be sorted for a stable diff)", got, want)
+	}
+}
+
+func TestBinaryArch(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "prog-linux-amd64", want: "amd64"},
+		{name: "prog-linux-arm", want: "arm"},
+		{name: "prog-linux-arm64", want: "arm64"},
+		{name: "prog-linux-arm-7", want: "arm"},
+		{name: "prog-darwin-10.6-amd64", want: "amd64"},
+		{name: "prog-windows-4.0-386.exe", want: "386"},
+	}
+	for _, tt := range tests {
+		if got := binaryArch(tt.name); got != tt.want {
+			t.Errorf("binaryArch(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatchBinaries(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"prog-linux-arm", "prog-linux-arm-5", "prog-linux-arm-6", "prog-linux-arm-7",
+		"prog-linux-arm64", "prog-linux-amd64",
+		"prog-darwin-10.6-amd64", "prog-windows-4.0-amd64.exe",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0755); err != nil {
+			t.Fatalf("WriteFile(%s): %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		goos   string
+		goarch string
+		want   []string
+	}{
+		{goos: "linux", goarch: "arm", want: []string{"prog-linux-arm", "prog-linux-arm-5", "prog-linux-arm-6", "prog-linux-arm-7"}},
+		{goos: "linux", goarch: "arm64", want: []string{"prog-linux-arm64"}},
+		{goos: "darwin", goarch: "amd64", want: []string{"prog-darwin-10.6-amd64"}},
+		{goos: "windows", goarch: "amd64", want: []string{"prog-windows-4.0-amd64.exe"}},
+	}
+	for _, tt := range tests {
+		matches, err := matchBinaries(dir, "prog", tt.goos, tt.goarch)
+		if err != nil {
+			t.Fatalf("matchBinaries(%s/%s): %v", tt.goos, tt.goarch, err)
+		}
+		got := make([]string, len(matches))
+		for i, m := range matches {
+			got[i] = filepath.Base(m)
+		}
+		sort.Strings(got)
+		want := append([]string(nil), tt.want...)
+		sort.Strings(want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("matchBinaries(%s/%s) = %v, want %v", tt.goos, tt.goarch, got, want)
+		}
+	}
+}
+
+func TestPackageAnchorsArchBoundary(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"prog-linux-arm", "prog-linux-arm64"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0755); err != nil {
+			t.Fatalf("WriteFile(%s): %v", name, err)
+		}
+	}
+	opts := Options{Type: "tar.gz", Dest: dir, Prefix: "prog"}
+
+	if err := Package(context.Background(), opts, []string{"linux/arm"}); err != nil {
+		t.Fatalf("Package: %v", err)
+	}
+	names, err := tarGzNames(filepath.Join(dir, "prog_linux_arm.tar.gz"))
+	if err != nil {
+		t.Fatalf("tarGzNames: %v", err)
+	}
+	want := []string{"prog-linux-arm"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("prog_linux_arm.tar.gz contains %v, want %v (must not bundle the arm64 binary)", names, want)
+	}
+}
+
+// tarGzNames lists the entry names of a tar.gz archive.
+func tarGzNames(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var names []string
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, header.Name)
+	}
+	return names, nil
+}
+
+func TestPackageSkipsWildcardTargets(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{Type: "tar.gz", Dest: dir, Prefix: "prog"}
+
+	if err := Package(context.Background(), opts, []string{"*/*"}); err != nil {
+		t.Fatalf("Package with a wildcard target: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "prog_*_*.tar.gz")); !os.IsNotExist(err) {
+		t.Errorf("Package with a wildcard target wrote an asterisk-named archive")
+	}
+}
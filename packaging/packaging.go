@@ -0,0 +1,212 @@
+// Go CGO cross compiler
+// Copyright (c) 2014 Péter Szilágyi. All rights reserved.
+//
+// Released under the MIT license.
+
+// Package packaging turns the linux binaries cross compiled by xgo into
+// native .deb/.rpm packages, driven by a xgo.yaml manifest checked into the
+// source repository. It's implemented on top of nfpm, which speaks both
+// formats in pure Go, so producing a .deb doesn't require a Debian host.
+package packaging
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/goreleaser/nfpm/v2"
+	"github.com/goreleaser/nfpm/v2/files"
+	"gopkg.in/yaml.v3"
+
+	_ "github.com/goreleaser/nfpm/v2/deb"
+	_ "github.com/goreleaser/nfpm/v2/rpm"
+)
+
+// Manifest is the xgo.yaml descriptor a repo ships to describe how its
+// cross-compiled binaries should be packaged.
+type Manifest struct {
+	Name        string            `yaml:"name"`
+	Version     string            `yaml:"version"`
+	Maintainer  string            `yaml:"maintainer"`
+	Description string            `yaml:"description"`
+	Depends     []string          `yaml:"depends"`
+	SystemdUnit string            `yaml:"systemd_unit"` // Path, relative to the repo, of a .service file
+	Config      map[string]string `yaml:"config"`       // repo-relative source -> /etc/<name>/<dest>
+}
+
+// Options configures the packaging step run after a cross compilation.
+type Options struct {
+	Formats []string // Package formats to emit: "deb", "rpm"
+	RepoDir string   // Local checkout holding xgo.yaml and any config/unit files it references
+	Dest    string   // Folder holding the cross-compiled binaries, and where packages are written
+	Prefix  string   // Output naming prefix the build used
+}
+
+// Package reads the xgo.yaml manifest out of RepoDir and, for every linux
+// target present in targets, emits one package per requested format into
+// Dest.
+func Package(ctx context.Context, opts Options, targets []string) error {
+	if len(opts.Formats) == 0 {
+		return nil
+	}
+	manifest, err := readManifest(filepath.Join(opts.RepoDir, "xgo.yaml"))
+	if err != nil {
+		return fmt.Errorf("failed to read xgo.yaml: %v", err)
+	}
+	for _, target := range targets {
+		goos, goarch, err := splitTarget(target)
+		if err != nil {
+			return err
+		}
+		if strings.ContainsAny(goos+goarch, "*?[") {
+			fmt.Printf("Target %s is a wildcard, skipping packaging (pass concrete os/arch pairs to -targets to package).\n", target)
+			continue
+		}
+		if goos != "linux" {
+			continue
+		}
+		binaries, err := matchBinaries(opts.Dest, opts.Prefix, goos, goarch)
+		if err != nil {
+			return err
+		}
+		if len(binaries) == 0 {
+			fmt.Printf("No linux/%s binary found, skipping packaging.\n", goarch)
+			continue
+		}
+		info, err := buildInfo(manifest, opts, binaries[0], goarch)
+		if err != nil {
+			return err
+		}
+		for _, format := range opts.Formats {
+			if err := writePackage(info, format, opts.Dest, goarch); err != nil {
+				return fmt.Errorf("failed to build %s package for %s: %v", format, target, err)
+			}
+		}
+	}
+	return nil
+}
+
+func readManifest(path string) (*Manifest, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{Version: "0.0.0"}
+	if err := yaml.Unmarshal(raw, manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Name == "" {
+		return nil, fmt.Errorf("xgo.yaml is missing the required \"name\" field")
+	}
+	return manifest, nil
+}
+
+func splitTarget(target string) (goos string, goarch string, err error) {
+	parts := strings.Split(target, "/")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid target %q, want os/arch", target)
+	}
+	return parts[0], parts[1], nil
+}
+
+// matchBinaries finds the binaries compile produced for goos/goarch. A plain
+// "prefix-goos-goarch*" glob over-matches: building both linux/arm and
+// linux/arm64 would have the linux/arm glob also pick up the arm64 binary
+// (and linux/arm's own ARM-version variants, e.g. "prog-linux-arm-7"), so
+// every candidate is matched by its actual trailing arch token instead.
+func matchBinaries(dest string, prefix string, goos string, goarch string) ([]string, error) {
+	candidates, err := filepath.Glob(filepath.Join(dest, fmt.Sprintf("%s-%s-*", prefix, goos)))
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, candidate := range candidates {
+		if binaryArch(filepath.Base(candidate)) == goarch {
+			matches = append(matches, candidate)
+		}
+	}
+	return matches, nil
+}
+
+// binaryArch extracts the GOARCH token a compile output name ends in, e.g.
+// "prog-linux-amd64" -> "amd64", "prog-linux-arm-7" -> "arm" (ARM builds
+// append the ARM version as a trailing numeric token, which isn't itself
+// part of the arch).
+func binaryArch(name string) string {
+	parts := strings.Split(name, "-")
+	if len(parts) == 0 {
+		return ""
+	}
+	last := parts[len(parts)-1]
+	if len(parts) >= 2 && parts[len(parts)-2] == "arm" {
+		if _, err := strconv.Atoi(last); err == nil {
+			return "arm"
+		}
+	}
+	return last
+}
+
+// buildInfo assembles the nfpm package descriptor for a single architecture.
+func buildInfo(manifest *Manifest, opts Options, binary string, goarch string) (*nfpm.Info, error) {
+	contents := files.Contents{
+		&files.Content{
+			Source:      binary,
+			Destination: filepath.Join("/usr/bin", manifest.Name),
+			FileInfo:    &files.ContentFileInfo{Mode: 0755},
+		},
+	}
+	if manifest.SystemdUnit != "" {
+		contents = append(contents, &files.Content{
+			Source:      filepath.Join(opts.RepoDir, manifest.SystemdUnit),
+			Destination: filepath.Join("/lib/systemd/system", manifest.Name+".service"),
+		})
+	}
+	for src, dst := range manifest.Config {
+		contents = append(contents, &files.Content{
+			Source:      filepath.Join(opts.RepoDir, src),
+			Destination: filepath.Join("/etc", manifest.Name, dst),
+			Type:        "config|noreplace",
+		})
+	}
+	info := &nfpm.Info{
+		Name:        manifest.Name,
+		Arch:        debianArch(goarch),
+		Platform:    "linux",
+		Version:     manifest.Version,
+		Maintainer:  manifest.Maintainer,
+		Description: manifest.Description,
+		Overridables: nfpm.Overridables{
+			Depends:  manifest.Depends,
+			Contents: contents,
+		},
+	}
+	return nfpm.WithDefaults(info), nil
+}
+
+// debianArch maps a GOARCH to the architecture name deb/rpm packages expect.
+func debianArch(goarch string) string {
+	switch goarch {
+	case "386":
+		return "i386"
+	default:
+		return goarch
+	}
+}
+
+func writePackage(info *nfpm.Info, format string, dest string, goarch string) error {
+	packager, err := nfpm.Get(format)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s_%s_%s.%s", info.Name, info.Version, goarch, format)
+	out, err := os.Create(filepath.Join(dest, name))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return packager.Package(info, out)
+}
@@ -0,0 +1,166 @@
+package packaging
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDebianArch(t *testing.T) {
+	tests := []struct {
+		goarch string
+		want   string
+	}{
+		{goarch: "386", want: "i386"},
+		{goarch: "amd64", want: "amd64"},
+		{goarch: "arm64", want: "arm64"},
+	}
+	for _, tt := range tests {
+		if got := debianArch(tt.goarch); got != tt.want {
+			t.Errorf("debianArch(%q) = %q, want %q", tt.goarch, got, tt.want)
+		}
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "xgo.yaml")
+
+	const yaml = "name: prog\nversion: 1.2.3\nmaintainer: someone@example.com\n"
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	manifest, err := readManifest(path)
+	if err != nil {
+		t.Fatalf("readManifest: %v", err)
+	}
+	if manifest.Name != "prog" || manifest.Version != "1.2.3" || manifest.Maintainer != "someone@example.com" {
+		t.Errorf("readManifest = %+v, want name=prog version=1.2.3 maintainer=someone@example.com", manifest)
+	}
+}
+
+func TestReadManifestDefaultsVersion(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "xgo.yaml")
+
+	if err := os.WriteFile(path, []byte("name: prog\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	manifest, err := readManifest(path)
+	if err != nil {
+		t.Fatalf("readManifest: %v", err)
+	}
+	if manifest.Version != "0.0.0" {
+		t.Errorf("readManifest without a version = %q, want the 0.0.0 default", manifest.Version)
+	}
+}
+
+func TestReadManifestRequiresName(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "xgo.yaml")
+
+	if err := os.WriteFile(path, []byte("version: 1.0.0\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := readManifest(path); err == nil {
+		t.Error("readManifest without a name: expected an error, got none")
+	}
+}
+
+func TestBinaryArch(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "prog-linux-amd64", want: "amd64"},
+		{name: "prog-linux-arm", want: "arm"},
+		{name: "prog-linux-arm64", want: "arm64"},
+		{name: "prog-linux-arm-7", want: "arm"},
+	}
+	for _, tt := range tests {
+		if got := binaryArch(tt.name); got != tt.want {
+			t.Errorf("binaryArch(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatchBinaries(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"prog-linux-arm", "prog-linux-arm-7", "prog-linux-arm64"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0755); err != nil {
+			t.Fatalf("WriteFile(%s): %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		goarch string
+		want   []string
+	}{
+		{goarch: "arm", want: []string{"prog-linux-arm", "prog-linux-arm-7"}},
+		{goarch: "arm64", want: []string{"prog-linux-arm64"}},
+	}
+	for _, tt := range tests {
+		matches, err := matchBinaries(dir, "prog", "linux", tt.goarch)
+		if err != nil {
+			t.Fatalf("matchBinaries(linux/%s): %v", tt.goarch, err)
+		}
+		got := make([]string, len(matches))
+		for i, m := range matches {
+			got[i] = filepath.Base(m)
+		}
+		sort.Strings(got)
+		want := append([]string(nil), tt.want...)
+		sort.Strings(want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("matchBinaries(linux/%s) = %v, want %v", tt.goarch, got, want)
+		}
+	}
+}
+
+func TestPackageAnchorsArchBoundary(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"prog-linux-arm", "prog-linux-arm64"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0755); err != nil {
+			t.Fatalf("WriteFile(%s): %v", name, err)
+		}
+	}
+	manifest := &Manifest{Name: "prog", Version: "1.0.0"}
+	opts := Options{Dest: dir, Prefix: "prog"}
+
+	binaries, err := matchBinaries(dir, "prog", "linux", "arm")
+	if err != nil {
+		t.Fatalf("matchBinaries: %v", err)
+	}
+	if len(binaries) != 1 || filepath.Base(binaries[0]) != "prog-linux-arm" {
+		t.Fatalf("matchBinaries(linux/arm) = %v, want only prog-linux-arm", binaries)
+	}
+	info, err := buildInfo(manifest, opts, binaries[0], "arm")
+	if err != nil {
+		t.Fatalf("buildInfo: %v", err)
+	}
+	if got := info.Overridables.Contents[0].Source; got != binaries[0] {
+		t.Errorf("buildInfo bundled %q, want the linux/arm binary %q", got, binaries[0])
+	}
+}
+
+func TestPackageSkipsWildcardTargets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "xgo.yaml"), []byte("name: prog\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	opts := Options{Formats: []string{"deb"}, RepoDir: dir, Dest: dir, Prefix: "prog"}
+
+	if err := Package(context.Background(), opts, []string{"*/*"}); err != nil {
+		t.Fatalf("Package with a wildcard target: %v", err)
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "*.deb"))
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("Package with a wildcard target wrote %v, want no packages", matches)
+	}
+}
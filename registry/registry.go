@@ -0,0 +1,85 @@
+// Go CGO cross compiler
+// Copyright (c) 2014 Péter Szilágyi. All rights reserved.
+//
+// Released under the MIT license.
+
+// Package registry looks up and pulls xgo build images directly through the
+// Docker Engine API and go-containerregistry, instead of scraping the output
+// of `docker images`/`docker pull`. That avoids breaking on locale or CLI
+// output changes and adds support for digest-pinned, reproducible pulls.
+package registry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/daemon"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// Exists reports whether image is already present in the local docker daemon.
+// If pin is non-empty, a matching tag is only considered present when one of
+// its RepoDigests is the pinned digest, so a stale local tag doesn't shadow a
+// newer pinned layer.
+func Exists(ctx context.Context, image string, pin string) (bool, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return false, fmt.Errorf("failed to reach docker daemon: %v", err)
+	}
+	defer cli.Close()
+
+	images, err := cli.ImageList(ctx, types.ImageListOptions{
+		Filters: filters.NewArgs(filters.Arg("reference", image)),
+	})
+	if err != nil {
+		return false, err
+	}
+	if pin == "" {
+		return len(images) > 0, nil
+	}
+	for _, img := range images {
+		for _, digest := range img.RepoDigests {
+			if strings.HasSuffix(digest, "@"+pin) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Pull fetches image straight from its registry and loads it into the local
+// docker daemon, honoring DOCKER_CONFIG credentials via the default keychain.
+// If pin is non-empty, it's used as the content digest (sha256:...) to fetch
+// instead of whatever the image's tag currently resolves to, so repeated
+// builds of the same xgo invocation use the exact same base layer.
+func Pull(ctx context.Context, image string, pin string) error {
+	src := image
+	if pin != "" {
+		src = image + "@" + pin
+	}
+	srcRef, err := name.ParseReference(src)
+	if err != nil {
+		return fmt.Errorf("invalid image reference %q: %v", src, err)
+	}
+	img, err := remote.Image(srcRef, remote.WithContext(ctx), remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %v", src, err)
+	}
+	// daemon.Write only accepts a tag: a digest can be fetched but a local
+	// daemon has nowhere to store a digest-only reference, so the image is
+	// always loaded back in under its plain tag, pinned or not.
+	dstTag, err := name.NewTag(image)
+	if err != nil {
+		return fmt.Errorf("invalid image tag %q: %v", image, err)
+	}
+	if _, err := daemon.Write(dstTag, img); err != nil {
+		return fmt.Errorf("failed to load %s into docker: %v", image, err)
+	}
+	return nil
+}
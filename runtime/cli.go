@@ -0,0 +1,97 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// cliRuntime implements Runtime on top of a docker-compatible CLI binary.
+// docker, podman and nerdctl all understand the same "version"/"images"/
+// "pull"/"run" vocabulary; the small differences are expressed via the
+// fields below rather than by branching at each call site.
+type cliRuntime struct {
+	binary       string   // CLI binary to exec: docker, podman or nerdctl
+	volumeOption string   // Extra -v mount option, e.g. "Z" for podman's SELinux label
+	extraRunArgs []string // Extra arguments inserted into every "run" invocation
+}
+
+func (r cliRuntime) Name() string {
+	return r.binary
+}
+
+func (r cliRuntime) Version(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, r.binary, "version")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func (r cliRuntime) ImageExists(ctx context.Context, image string) (bool, error) {
+	out, err := exec.CommandContext(ctx, r.binary, "images", "--no-trunc").Output()
+	if err != nil {
+		return false, err
+	}
+	return bytes.Contains(out, []byte(image)), nil
+}
+
+func (r cliRuntime) Pull(ctx context.Context, image string) error {
+	cmd := exec.CommandContext(ctx, r.binary, "pull", image)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func (r cliRuntime) Run(ctx context.Context, spec RunSpec) error {
+	cmd := exec.CommandContext(ctx, r.binary, r.runArgs(spec)...)
+	cmd.Stdout = orDefault(spec.Stdout, os.Stdout)
+	cmd.Stderr = orDefault(spec.Stderr, os.Stderr)
+	return cmd.Run()
+}
+
+// runArgs assembles the "run" CLI arguments for spec, folding in the
+// backend-specific volume option and extra run arguments.
+func (r cliRuntime) runArgs(spec RunSpec) []string {
+	args := []string{"run", "--rm"}
+	if spec.Name != "" {
+		args = append(args, "--name", spec.Name)
+	}
+	args = append(args, r.extraRunArgs...)
+
+	for _, v := range spec.Volumes {
+		mount := fmt.Sprintf("%s:%s", v.Host, v.Container)
+
+		var opts []string
+		if v.ReadOnly {
+			opts = append(opts, "ro")
+		}
+		if r.volumeOption != "" {
+			opts = append(opts, r.volumeOption)
+		}
+		if len(opts) > 0 {
+			mount += ":" + strings.Join(opts, ",")
+		}
+		args = append(args, "-v", mount)
+	}
+	for _, e := range spec.Env {
+		args = append(args, "-e", e)
+	}
+	args = append(args, spec.Image)
+	args = append(args, spec.Args...)
+	return args
+}
+
+func orDefault(w io.Writer, def io.Writer) io.Writer {
+	if w != nil {
+		return w
+	}
+	return def
+}
+
+func (r cliRuntime) Kill(name string) {
+	exec.Command(r.binary, "kill", name).Run()
+}
@@ -0,0 +1,95 @@
+package runtime
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestCliRuntimeRunArgs(t *testing.T) {
+	spec := RunSpec{
+		Name:  "xgo-build",
+		Image: "karalabe/xgo-latest",
+		Args:  []string{"build"},
+		Volumes: []Volume{
+			{Host: "/src", Container: "/go/src/pkg"},
+			{Host: "/out", Container: "/out", ReadOnly: true},
+		},
+		Env: []string{"CGO_ENABLED=1"},
+	}
+
+	tests := []struct {
+		name string
+		r    cliRuntime
+		want []string
+	}{
+		{
+			name: "docker",
+			r:    cliRuntime{binary: "docker"},
+			want: []string{
+				"run", "--rm", "--name", "xgo-build",
+				"-v", "/src:/go/src/pkg",
+				"-v", "/out:/out:ro",
+				"-e", "CGO_ENABLED=1",
+				"karalabe/xgo-latest", "build",
+			},
+		},
+		{
+			name: "podman",
+			r: cliRuntime{
+				binary:       "podman",
+				volumeOption: "Z",
+				extraRunArgs: []string{"--userns=keep-id"},
+			},
+			want: []string{
+				"run", "--rm", "--name", "xgo-build",
+				"--userns=keep-id",
+				"-v", "/src:/go/src/pkg:Z",
+				"-v", "/out:/out:ro,Z",
+				"-e", "CGO_ENABLED=1",
+				"karalabe/xgo-latest", "build",
+			},
+		},
+		{
+			name: "nerdctl",
+			r:    cliRuntime{binary: "nerdctl"},
+			want: []string{
+				"run", "--rm", "--name", "xgo-build",
+				"-v", "/src:/go/src/pkg",
+				"-v", "/out:/out:ro",
+				"-e", "CGO_ENABLED=1",
+				"karalabe/xgo-latest", "build",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.r.runArgs(spec)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("runArgs() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCliRuntimeRunArgsWithoutName(t *testing.T) {
+	r := cliRuntime{binary: "docker"}
+	spec := RunSpec{Image: "karalabe/xgo-latest"}
+
+	got := r.runArgs(spec)
+	want := []string{"run", "--rm", "karalabe/xgo-latest"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("runArgs() = %#v, want %#v", got, want)
+	}
+}
+
+func TestOrDefault(t *testing.T) {
+	var buf bytes.Buffer
+	if got := orDefault(&buf, os.Stdout); got != &buf {
+		t.Error("orDefault with a non-nil writer should return that writer")
+	}
+	if got := orDefault(nil, os.Stdout); got != os.Stdout {
+		t.Error("orDefault with a nil writer should return the default")
+	}
+}
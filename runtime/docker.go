@@ -0,0 +1,24 @@
+package runtime
+
+import (
+	"context"
+
+	"github.com/karalabe/xgo/registry"
+)
+
+// dockerRuntime drives the build container through the docker CLI, but
+// resolves and pulls images through the Docker Engine API and
+// go-containerregistry rather than scraping `docker images`/`docker pull`
+// text output.
+type dockerRuntime struct {
+	cliRuntime
+	pin string // Optional content digest to pull instead of the image's tag
+}
+
+func (d dockerRuntime) ImageExists(ctx context.Context, image string) (bool, error) {
+	return registry.Exists(ctx, image, d.pin)
+}
+
+func (d dockerRuntime) Pull(ctx context.Context, image string) error {
+	return registry.Pull(ctx, image, d.pin)
+}
@@ -0,0 +1,107 @@
+// Go CGO cross compiler
+// Copyright (c) 2014 Péter Szilágyi. All rights reserved.
+//
+// Released under the MIT license.
+
+// Package runtime abstracts the container engine xgo shells out to, so the
+// build pipeline isn't hard wired to docker. Podman and nerdctl speak a
+// docker-compatible CLI, but differ enough in flag handling (SELinux volume
+// labels, rootless user namespaces) that those differences need to live in
+// the backend rather than at every call site.
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// Volume is a single bind mount into the build container.
+type Volume struct {
+	Host      string // Path on the host
+	Container string // Path inside the container
+	ReadOnly  bool
+}
+
+// RunSpec describes a single container invocation.
+type RunSpec struct {
+	Name    string   // Stable container name, used to kill it on cancellation
+	Image   string   // Image to run
+	Args    []string // Arguments passed to the image entrypoint
+	Volumes []Volume
+	Env     []string // "KEY=value" pairs
+
+	// Stdout and Stderr receive the container's output. Both default to
+	// os.Stdout/os.Stderr when nil, so callers running a single container
+	// can leave them unset; concurrent callers typically pass a writer that
+	// prefixes each line to keep interleaved logs readable.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Runtime is a container engine capable of pulling images and running the
+// xgo build container.
+type Runtime interface {
+	// Name returns the backend identifier, e.g. "docker", "podman", "nerdctl".
+	Name() string
+
+	// Version checks that the engine is installed and responsive.
+	Version(ctx context.Context) error
+
+	// ImageExists reports whether an image is already present locally.
+	ImageExists(ctx context.Context, image string) (bool, error)
+
+	// Pull retrieves an image from its registry.
+	Pull(ctx context.Context, image string) error
+
+	// Run executes a build container per spec, streaming output to stdout/stderr.
+	Run(ctx context.Context, spec RunSpec) error
+
+	// Kill stops a still-running container by name, best effort.
+	Kill(name string)
+}
+
+// dockerBackend drives the build container through the docker CLI, resolving
+// and pulling images through the Docker Engine API instead. pin, if set, is
+// the image content digest (sha256:...) to pull for reproducible builds.
+func dockerBackend(pin string) Runtime {
+	return dockerRuntime{cliRuntime: cliRuntime{binary: "docker"}, pin: pin}
+}
+
+// podmanBackend drives the build container through podman, adding the
+// SELinux ":Z" volume label and rootless user-namespace mapping that Docker
+// doesn't need but Podman benefits from.
+func podmanBackend() Runtime {
+	return cliRuntime{
+		binary:       "podman",
+		volumeOption: "Z",
+		extraRunArgs: []string{"--userns=keep-id"},
+	}
+}
+
+// nerdctlBackend drives the build container through nerdctl (containerd).
+func nerdctlBackend() Runtime {
+	return cliRuntime{binary: "nerdctl"}
+}
+
+// Detect picks a runtime backend. If name is non-empty it is used verbatim;
+// otherwise podman is preferred when present (it's the Fedora/RHEL default),
+// falling back to docker. pin only applies to the docker backend.
+func Detect(ctx context.Context, name string, pin string) (Runtime, error) {
+	switch name {
+	case "docker":
+		return dockerBackend(pin), nil
+	case "podman":
+		return podmanBackend(), nil
+	case "nerdctl":
+		return nerdctlBackend(), nil
+	case "":
+		if exec.CommandContext(ctx, "podman", "version").Run() == nil {
+			return podmanBackend(), nil
+		}
+		return dockerBackend(pin), nil
+	default:
+		return nil, fmt.Errorf("unknown container runtime %q, want docker, podman or nerdctl", name)
+	}
+}
@@ -8,6 +8,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"go/build"
@@ -15,10 +16,18 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
+	goruntime "runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/karalabe/xgo/archive"
+	"github.com/karalabe/xgo/packaging"
+	"github.com/karalabe/xgo/runtime"
+	"golang.org/x/sync/errgroup"
 )
 
 // Path where to cache external dependencies
@@ -30,15 +39,29 @@ var dockerDist = "karalabe/xgo-"
 
 // Command line arguments to fine tune the compilation
 var (
-	goVersion   = flag.String("go", "latest", "Go release to use for cross compilation")
-	inPackage   = flag.String("pkg", "", "Sub-package to build if not root import")
-	outPrefix   = flag.String("out", "", "Prefix to use for output naming (empty = package name)")
-	outFolder   = flag.String("dest", "", "Destination folder to put binaries in (empty = current)")
-	srcRemote   = flag.String("remote", "", "Version control remote repository to build")
-	srcBranch   = flag.String("branch", "", "Version control branch to build")
-	crossDeps   = flag.String("deps", "", "CGO dependencies (configure/make based archives)")
-	targets     = flag.String("targets", "*/*", "Comma separated targets to build for")
-	dockerImage = flag.String("image", "", "Use custom docker image instead of official distribution")
+	goVersion    = flag.String("go", "latest", "Go release to use for cross compilation")
+	inPackage    = flag.String("pkg", "", "Sub-package to build if not root import")
+	outPrefix    = flag.String("out", "", "Prefix to use for output naming (empty = package name)")
+	outFolder    = flag.String("dest", "", "Destination folder to put binaries in (empty = current)")
+	srcRemote    = flag.String("remote", "", "Version control remote repository to build")
+	srcBranch    = flag.String("branch", "", "Version control branch to build")
+	crossDeps    = flag.String("deps", "", "CGO dependencies (configure/make based archives)")
+	targets      = flag.String("targets", "*/*", "Comma separated targets to build for")
+	dockerImage  = flag.String("image", "", "Use custom docker image instead of official distribution")
+	buildTimeout = flag.Duration("timeout", 0, "Abort the build if it runs longer than this (0 = no limit)")
+
+	containerRuntime = flag.String("runtime", "", "Container runtime to use: docker, podman or nerdctl (empty = auto-detect)")
+	imagePin         = flag.String("pin", "", "Pin the base docker image to this content digest (sha256:...) for reproducible builds")
+	buildParallel    = flag.Int("parallel", goruntime.NumCPU(), "Maximum number of targets to cross compile concurrently")
+)
+
+// Command line arguments to control post-build packaging of the binaries
+var (
+	archiveType   = flag.String("archive", "", "Package binaries into release archives: zip or tar.gz (empty = don't package)")
+	archiveSigner = flag.String("signer", "", "Env var holding an ASCII-armored GPG key to sign archives with")
+	archiveUpload = flag.String("upload", "", "URL to upload archives and the checksum manifest to")
+
+	packageFormats = flag.String("package", "", "Emit native packages from a xgo.yaml manifest: deb, rpm or both, comma separated")
 )
 
 // Command line arguments to pass to go build
@@ -49,28 +72,46 @@ var buildRace = flag.Bool("race", false, "Enable data race detection (supported
 func main() {
 	flag.Parse()
 
-	// Ensure docker is available
-	if err := checkDocker(); err != nil {
-		log.Fatalf("Failed to check docker installation: %v.", err)
+	// Tear the whole build down on Ctrl-C/SIGTERM, and optionally on a deadline
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if *buildTimeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, *buildTimeout)
+		defer cancelTimeout()
+	}
+	// Select the container runtime backend, auto-detecting if not pinned
+	rt, err := runtime.Detect(ctx, *containerRuntime, *imagePin)
+	if err != nil {
+		log.Fatalf("Failed to select container runtime: %v.", err)
+	}
+	// Ensure the runtime is available
+	if err := checkRuntime(ctx, rt); err != nil {
+		log.Fatalf("Failed to check %s installation: %v.", rt.Name(), err)
 	}
 	// Validate the command line arguments
 	if len(flag.Args()) != 1 {
 		log.Fatalf("Usage: %s [options] <go import path>", os.Args[0])
 	}
+	if *packageFormats != "" && !isLocalSource(flag.Args()[0]) {
+		log.Fatalf("-package requires a local source path (e.g. ./myrepo), not a remote import path %q: native packaging reads xgo.yaml off the host checkout.", flag.Args()[0])
+	}
 	// Select the image to use, either official or custom
 	image := dockerDist + *goVersion
 	if *dockerImage != "" {
 		image = *dockerImage
 	}
 	// Check that all required images are available
-	found, err := checkDockerImage(image)
+	fmt.Printf("Checking for required %s image %s... ", rt.Name(), image)
+	found, err := rt.ImageExists(ctx, image)
 	switch {
 	case err != nil:
-		log.Fatalf("Failed to check docker image availability: %v.", err)
+		log.Fatalf("Failed to check %s image availability: %v.", rt.Name(), err)
 	case !found:
 		fmt.Println("not found!")
-		if err := pullDockerImage(image); err != nil {
-			log.Fatalf("Failed to pull docker image from the registry: %v.", err)
+		if err := rt.Pull(ctx, image); err != nil {
+			log.Fatalf("Failed to pull %s image from the registry: %v.", rt.Name(), err)
 		}
 	default:
 		fmt.Println("found.")
@@ -111,39 +152,77 @@ func main() {
 		}
 	}
 	// Cross compile the requested package into the local folder
-	if err := compile(flag.Args()[0], image, *srcRemote, *srcBranch, *inPackage, *crossDeps, *outFolder, *outPrefix, *buildVerbose, *buildSteps, *buildRace, strings.Split(*targets, ",")); err != nil {
+	if err := compile(ctx, rt, flag.Args()[0], image, *srcRemote, *srcBranch, *inPackage, *crossDeps, *outFolder, *outPrefix, *buildVerbose, *buildSteps, *buildRace, strings.Split(*targets, ",")); err != nil {
 		log.Fatalf("Failed to cross compile package: %v.", err)
 	}
+	dest, err := resolveDest(*outFolder)
+	if err != nil {
+		log.Fatalf("Failed to resolve destination folder: %v.", err)
+	}
+	// Package, checksum, sign and upload the binaries if requested
+	if *archiveType != "" {
+		opts := archive.Options{
+			Type:   *archiveType,
+			Dest:   dest,
+			Prefix: outputPrefix(*outPrefix, flag.Args()[0]),
+			Signer: *archiveSigner,
+			Upload: *archiveUpload,
+		}
+		if err := archive.Package(ctx, opts, strings.Split(*targets, ",")); err != nil {
+			log.Fatalf("Failed to package release archives: %v.", err)
+		}
+	}
+	// Emit native .deb/.rpm packages if requested
+	if *packageFormats != "" {
+		opts := packaging.Options{
+			Formats: strings.Split(*packageFormats, ","),
+			RepoDir: flag.Args()[0],
+			Dest:    dest,
+			Prefix:  outputPrefix(*outPrefix, flag.Args()[0]),
+		}
+		if err := packaging.Package(ctx, opts, strings.Split(*targets, ",")); err != nil {
+			log.Fatalf("Failed to build native packages: %v.", err)
+		}
+	}
 }
 
-// Checks whether a docker installation can be found and is functional.
-func checkDocker() error {
-	fmt.Println("Checking docker installation...")
-	if err := run(exec.Command("docker", "version")); err != nil {
-		return err
+// resolveDest returns the folder binaries were written into: the explicit
+// -dest folder if one was given, otherwise the current working directory.
+func resolveDest(outFolder string) (string, error) {
+	if outFolder != "" {
+		return filepath.Abs(outFolder)
 	}
-	fmt.Println()
-	return nil
+	return os.Getwd()
 }
 
-// Checks whether a required docker image is available locally.
-func checkDockerImage(image string) (bool, error) {
-	fmt.Printf("Checking for required docker image %s... ", image)
-	out, err := exec.Command("docker", "images", "--no-trunc").Output()
-	if err != nil {
-		return false, err
+// outputPrefix mirrors the naming the build container falls back to when no
+// explicit -out prefix was given: the base name of the import path.
+func outputPrefix(prefix string, repo string) string {
+	if prefix != "" {
+		return prefix
 	}
-	return bytes.Contains(out, []byte(image)), nil
+	return filepath.Base(repo)
+}
+
+// isLocalSource reports whether repo is a filesystem path already checked out
+// on the host, as opposed to a remote import path that compile resolves and
+// fetches inside the build container.
+func isLocalSource(repo string) bool {
+	return strings.HasPrefix(repo, string(filepath.Separator)) || strings.HasPrefix(repo, ".")
 }
 
-// Pulls an image from the docker registry.
-func pullDockerImage(image string) error {
-	fmt.Printf("Pulling %s from docker registry...\n", image)
-	return run(exec.Command("docker", "pull", image))
+// Checks whether a container runtime installation can be found and is functional.
+func checkRuntime(ctx context.Context, rt runtime.Runtime) error {
+	fmt.Printf("Checking %s installation...\n", rt.Name())
+	if err := rt.Version(ctx); err != nil {
+		return err
+	}
+	fmt.Println()
+	return nil
 }
 
 // Cross compiles a requested package into the current working directory.
-func compile(repo string, image string, remote string, branch string, pack string, deps string, dest string, prefix string, verbose bool, steps bool, race bool, targets []string) error {
+func compile(ctx context.Context, rt runtime.Runtime, repo string, image string, remote string, branch string, pack string, deps string, dest string, prefix string, verbose bool, steps bool, race bool, targets []string) error {
 	// Retrieve the current folder to store the binaries in
 	folder, err := os.Getwd()
 	if err != nil {
@@ -157,7 +236,7 @@ func compile(repo string, image string, remote string, branch string, pack strin
 	}
 	// If a local build was requested, find the import path and mount all GOPATH sources
 	locals, mounts, paths := []string{}, []string{}, []string{}
-	if strings.HasPrefix(repo, string(filepath.Separator)) || strings.HasPrefix(repo, ".") {
+	if isLocalSource(repo) {
 		// Resolve the repository import path from the file path
 		path, err := filepath.Abs(repo)
 		if err != nil {
@@ -206,36 +285,126 @@ func compile(repo string, image string, remote string, branch string, pack strin
 			paths = append(paths, filepath.Join("/ext-go", strconv.Itoa(len(locals))))
 		}
 	}
-	// Assemble and run the cross compilation command
+	// Fan the targets out across one build container each, bounded by -parallel
 	fmt.Printf("Cross compiling %s...\n", repo)
 
-	args := []string{
-		"run", "--rm",
-		"-v", folder + ":/build",
-		"-v", depsCache + ":/deps-cache:ro",
-		"-e", "REPO_REMOTE=" + remote,
-		"-e", "REPO_BRANCH=" + branch,
-		"-e", "PACK=" + pack,
-		"-e", "DEPS=" + deps,
-		"-e", "OUT=" + prefix,
-		"-e", fmt.Sprintf("FLAG_V=%v", verbose),
-		"-e", fmt.Sprintf("FLAG_X=%v", steps),
-		"-e", fmt.Sprintf("FLAG_RACE=%v", race),
-		"-e", "TARGETS=" + strings.Replace(strings.Join(targets, " "), "*", ".", -1),
+	baseEnv := []string{
+		"REPO_REMOTE=" + remote,
+		"REPO_BRANCH=" + branch,
+		"PACK=" + pack,
+		"DEPS=" + deps,
+		"OUT=" + prefix,
+		fmt.Sprintf("FLAG_V=%v", verbose),
+		fmt.Sprintf("FLAG_X=%v", steps),
+		fmt.Sprintf("FLAG_RACE=%v", race),
+	}
+	baseVolumes := []runtime.Volume{
+		{Host: depsCache, Container: "/deps-cache", ReadOnly: true},
 	}
 	for i := 0; i < len(locals); i++ {
-		args = append(args, []string{"-v", fmt.Sprintf("%s:%s:ro", locals[i], mounts[i])}...)
+		baseVolumes = append(baseVolumes, runtime.Volume{Host: locals[i], Container: mounts[i], ReadOnly: true})
 	}
-	args = append(args, []string{"-e", "EXT_GOPATH=" + strings.Join(paths, ":")}...)
+	baseEnv = append(baseEnv, "EXT_GOPATH="+strings.Join(paths, ":"))
 
-	args = append(args, []string{image, repo}...)
-	return run(exec.Command("docker", args...))
+	parallel := *buildParallel
+	if parallel < 1 {
+		parallel = 1
+	}
+	group, gctx := errgroup.WithContext(ctx)
+	sem := make(chan struct{}, parallel)
+
+	for _, target := range targets {
+		target := target
+		group.Go(func() error {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			return compileTarget(gctx, rt, repo, image, target, folder, baseVolumes, baseEnv)
+		})
+	}
+	err = group.Wait()
+	os.Remove(filepath.Join(folder, "build")) // best effort, only succeeds once empty
+	return err
 }
 
-// Executes a command synchronously, redirecting its output to stdout.
-func run(cmd *exec.Cmd) error {
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// compileTarget cross compiles a single target in its own build container,
+// writing into a private subdirectory of folder to avoid write collisions
+// with the other targets building concurrently, then moves the resulting
+// binaries back up into folder.
+func compileTarget(ctx context.Context, rt runtime.Runtime, repo string, image string, target string, folder string, baseVolumes []runtime.Volume, baseEnv []string) error {
+	label := sanitizeContainerName(target)
+
+	sub := filepath.Join(folder, "build", label)
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		return fmt.Errorf("failed to create build directory for %s: %v", target, err)
+	}
+	defer os.RemoveAll(sub)
 
-	return cmd.Run()
+	container := fmt.Sprintf("xgo-%d-%s-%s", os.Getpid(), sanitizeContainerName(repo), label)
+	spec := runtime.RunSpec{
+		Name:    container,
+		Image:   image,
+		Args:    []string{repo},
+		Volumes: append([]runtime.Volume{{Host: sub, Container: "/build"}}, baseVolumes...),
+		Env:     append(append([]string{}, baseEnv...), "TARGETS="+strings.Replace(target, "*", ".", -1)),
+		Stdout:  &prefixWriter{prefix: target, out: os.Stdout},
+		Stderr:  &prefixWriter{prefix: target, out: os.Stderr},
+	}
+	if err := rt.Run(ctx, spec); err != nil {
+		// The client process is dead, but if we got here through cancellation the
+		// container it spawned is likely still running on the daemon: reap it.
+		if ctx.Err() != nil {
+			rt.Kill(container)
+		}
+		return fmt.Errorf("%s: %v", target, err)
+	}
+	binaries, err := filepath.Glob(filepath.Join(sub, "*"))
+	if err != nil {
+		return fmt.Errorf("failed to collect %s binaries: %v", target, err)
+	}
+	for _, binary := range binaries {
+		if err := os.Rename(binary, filepath.Join(folder, filepath.Base(binary))); err != nil {
+			return fmt.Errorf("failed to move %s into place: %v", binary, err)
+		}
+	}
+	return nil
+}
+
+// prefixWriter line-prefixes everything written to it before forwarding it to
+// out, so interleaved output from concurrently building targets stays
+// readable.
+type prefixWriter struct {
+	prefix string
+	out    io.Writer
+	buf    bytes.Buffer
+	mu     sync.Mutex
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(p)
+	for {
+		line, err := w.buf.ReadString('\n')
+		if err != nil {
+			// Incomplete line: put it back for the next Write.
+			w.buf.WriteString(line)
+			break
+		}
+		fmt.Fprintf(w.out, "[%s] %s", w.prefix, line)
+	}
+	return len(p), nil
+}
+
+// sanitizeContainerName turns a package import path into something docker
+// accepts as part of a --name (alphanumerics, underscore, dot and dash only).
+func sanitizeContainerName(repo string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			return r
+		default:
+			return '-'
+		}
+	}, repo)
 }